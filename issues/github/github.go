@@ -0,0 +1,376 @@
+// vim: ts=4:sw=4
+
+// Package github implements issues.Tracker against the GitHub REST v3 API,
+// mapping its issues/comments/sub-issues/cross-reference model onto the
+// shared issues.Issue/Comment/Link types.
+package github
+
+import (
+	"fmt"
+	"issues"
+	"jsonutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultBaseURL is the API root for github.com; pass a different baseURL
+// to NewTracker to talk to a GitHub Enterprise Server instance instead.
+const DefaultBaseURL = "https://api.github.com"
+
+const DefaultPerPage = 100
+
+// Tracker fetches every issue (and its comments, sub-issues and
+// cross-references) from a single GitHub repository.
+type Tracker struct {
+	baseURL string
+	owner   string
+	repo    string
+	perPage int
+	total   int // last page number, discovered from the first page's Link header
+	DB      issues.Store
+	client  *http.Client
+}
+
+// NewTracker creates a Tracker that fetches issues from owner/repo and
+// writes them to store. client is used for every request, so an
+// authenticated client (see jsonutil.NewBasicAuthClient) can be passed for
+// private repositories or a higher rate limit; a nil client falls back to
+// http.DefaultClient. baseURL selects the API root; "" defaults to
+// DefaultBaseURL. A nil store defaults to a fresh in-memory issues.Database.
+func NewTracker(baseURL, owner, repo string, client *http.Client, store issues.Store) *Tracker {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if store == nil {
+		store = issues.NewDatabase()
+	}
+	return &Tracker{
+		baseURL: baseURL,
+		owner:   owner,
+		repo:    repo,
+		perPage: DefaultPerPage,
+		DB:      store,
+		client:  client,
+	}
+}
+
+func (t *Tracker) url(path string) string {
+	return fmt.Sprintf("%s/repos/%s/%s%s", t.baseURL, t.owner, t.repo, path)
+}
+
+// id builds the Id this package uses for an issue: "owner/repo#number",
+// which stays unique across repositories -- unlike a single jira.Tracker, a
+// GitHub repository's sub-issues and cross-references can point into a
+// different repository entirely.
+func id(owner, repo string, number int) issues.Id {
+	return issues.Id(fmt.Sprintf("%s/%s#%d", owner, repo, number))
+}
+
+func parseDate(s string) time.Time {
+	// ignore parse errors (returning UNIX time 0 is sufficient); an empty
+	// string (an omitted or null field) is expected to fail to parse
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+// lastPageRE extracts the page number of a rel="last" link from a GitHub
+// Link response header, e.g.
+// `<https://api.github.com/...?page=2>; rel="next", <...?page=34>; rel="last"`.
+var lastPageRE = regexp.MustCompile(`[?&]page=(\d+)[^,]*>;\s*rel="last"`)
+
+// lastPage returns the final page number advertised by a Link header, or 1
+// if there is no rel="last" link (everything fit on a single page).
+func lastPage(link string) int {
+	m := lastPageRE.FindStringSubmatch(link)
+	if m == nil {
+		return 1
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 1
+	}
+	return n
+}
+
+// IssueDTO is the shape of an element of GET /repos/:owner/:repo/issues.
+// GitHub's issues endpoint also returns pull requests; PullRequest is
+// non-nil exactly when an element is one, so callers can skip it.
+type IssueDTO struct {
+	Number      int       `json:"number"`
+	Title       string    `json:"title"`
+	Body        string    `json:"body"`
+	State       string    `json:"state"`
+	CreatedAt   string    `json:"created_at"`
+	UpdatedAt   string    `json:"updated_at"`
+	User        UserDTO   `json:"user"`
+	PullRequest *struct{} `json:"pull_request"`
+}
+
+type UserDTO struct {
+	Login string `json:"login"`
+	Email string `json:"email"`
+}
+
+// CommentDTO is the shape of an element of GET .../issues/:number/comments.
+type CommentDTO struct {
+	Body      string  `json:"body"`
+	CreatedAt string  `json:"created_at"`
+	User      UserDTO `json:"user"`
+}
+
+// SubIssueDTO is the shape of an element of GET .../issues/:number/sub_issues.
+// Repository is nil when the sub-issue lives in the same repository as its
+// parent, which is the common case.
+type SubIssueDTO struct {
+	Number     int         `json:"number"`
+	Repository *RepoRefDTO `json:"repository"`
+}
+
+type RepoRefDTO struct {
+	Name  string  `json:"name"`
+	Owner UserDTO `json:"owner"`
+}
+
+// TimelineEventDTO is the shape of an element of GET .../issues/:number/timeline.
+// Only "cross-referenced" events (another issue mentioning this one via
+// "#nnn" or a full URL) carry a non-nil Source, and that's the only kind
+// this package turns into a Link.
+type TimelineEventDTO struct {
+	Event  string             `json:"event"`
+	Source *TimelineSourceDTO `json:"source"`
+}
+
+type TimelineSourceDTO struct {
+	Issue *TimelineIssueRefDTO `json:"issue"`
+}
+
+type TimelineIssueRefDTO struct {
+	Number     int        `json:"number"`
+	Repository RepoRefDTO `json:"repository"`
+}
+
+// fetchPage fetches one page of the repository's issue list (every state,
+// oldest first). The first page's Link header tells us the total page
+// count, so FetchAll knows how many pages the rest of its workers have to
+// split up -- GitHub issues pages support random access via ?page=, same as
+// JIRA's startAt.
+func (t *Tracker) fetchPage(page int) ([]IssueDTO, error) {
+	params := map[string]string{
+		"state":     "all",
+		"sort":      "created",
+		"direction": "asc",
+		"per_page":  strconv.Itoa(t.perPage),
+		"page":      strconv.Itoa(page),
+	}
+	resp, err := jsonutil.GetResponse(t.client, t.url("/issues"), params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if page == 1 {
+		t.total = lastPage(resp.Header.Get("Link"))
+	}
+	var dtos []IssueDTO
+	if err := jsonutil.Decode(resp.Body, &dtos); err != nil {
+		return nil, err
+	}
+	return dtos, nil
+}
+
+// fetchComments fetches every comment on issue number, across as many
+// pages as it takes.
+func (t *Tracker) fetchComments(number int) ([]CommentDTO, error) {
+	var all []CommentDTO
+	for page := 1; ; page++ {
+		var dtos []CommentDTO
+		params := map[string]string{"per_page": strconv.Itoa(t.perPage), "page": strconv.Itoa(page)}
+		if err := jsonutil.Get(t.client, t.url(fmt.Sprintf("/issues/%d/comments", number)), params, &dtos); err != nil {
+			return nil, err
+		}
+		all = append(all, dtos...)
+		if len(dtos) < t.perPage {
+			return all, nil
+		}
+	}
+}
+
+// fetchSubIssues fetches issue number's direct sub-issues, which become
+// tree edges back to it. Sub-issues are a recent, opt-in GitHub feature, so
+// most repositories 404 on this endpoint; that's treated the same as "no
+// sub-issues" rather than a fatal error, or -backend=github would fail on
+// every issue against a typical repository.
+func (t *Tracker) fetchSubIssues(number int) ([]SubIssueDTO, error) {
+	var dtos []SubIssueDTO
+	params := map[string]string{"per_page": strconv.Itoa(t.perPage)}
+	err := jsonutil.Get(t.client, t.url(fmt.Sprintf("/issues/%d/sub_issues", number)), params, &dtos)
+	if statusErr, ok := err.(*jsonutil.StatusError); ok && statusErr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dtos, nil
+}
+
+// fetchTimeline fetches issue number's full timeline, across as many pages
+// as it takes; only its cross-reference events are used.
+func (t *Tracker) fetchTimeline(number int) ([]TimelineEventDTO, error) {
+	var all []TimelineEventDTO
+	for page := 1; ; page++ {
+		var dtos []TimelineEventDTO
+		params := map[string]string{"per_page": strconv.Itoa(t.perPage), "page": strconv.Itoa(page)}
+		if err := jsonutil.Get(t.client, t.url(fmt.Sprintf("/issues/%d/timeline", number)), params, &dtos); err != nil {
+			return nil, err
+		}
+		all = append(all, dtos...)
+		if len(dtos) < t.perPage {
+			return all, nil
+		}
+	}
+}
+
+func issueFromDTO(owner, repo string, dto IssueDTO) issues.Issue {
+	return issues.Issue{
+		Id:       id(owner, repo, dto.Number),
+		Name:     fmt.Sprintf("#%d", dto.Number),
+		Title:    dto.Title,
+		Body:     dto.Body,
+		Status:   dto.State,
+		Created:  parseDate(dto.CreatedAt),
+		Updated:  parseDate(dto.UpdatedAt),
+		Reporter: dto.User.Login,
+	}
+}
+
+func commentFromDTO(dto CommentDTO) issues.Comment {
+	return issues.Comment{
+		AuthorName:  dto.User.Login,
+		AuthorEmail: dto.User.Email,
+		Created:     parseDate(dto.CreatedAt),
+		Body:        dto.Body,
+	}
+}
+
+// processIssue stores dto and everything hanging off it: its comments, its
+// sub-issues (as tree edges), and the cross-references discovered in its
+// timeline (as graph links).
+func (t *Tracker) processIssue(dto IssueDTO) error {
+	if dto.PullRequest != nil {
+		// GitHub's issues endpoint also returns pull requests; this
+		// Tracker only tracks issues.
+		return nil
+	}
+	issue := issueFromDTO(t.owner, t.repo, dto)
+
+	comments, err := t.fetchComments(dto.Number)
+	if err != nil {
+		return err
+	}
+	issue.Comments = make([]issues.Comment, 0, len(comments))
+	for _, c := range comments {
+		issue.Comments = append(issue.Comments, commentFromDTO(c))
+	}
+	if err := t.DB.UpsertIssue(issue); err != nil {
+		return err
+	}
+
+	subIssues, err := t.fetchSubIssues(dto.Number)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subIssues {
+		childOwner, childRepo := t.owner, t.repo
+		if sub.Repository != nil {
+			childOwner, childRepo = sub.Repository.Owner.Login, sub.Repository.Name
+		}
+		if err := t.DB.SetParent(id(childOwner, childRepo, sub.Number), issue.Id); err != nil {
+			return err
+		}
+	}
+
+	events, err := t.fetchTimeline(dto.Number)
+	if err != nil {
+		return err
+	}
+	for _, ev := range events {
+		if ev.Event != "cross-referenced" || ev.Source == nil || ev.Source.Issue == nil {
+			continue
+		}
+		ref := ev.Source.Issue
+		if err := t.DB.AddLink(issues.Link{
+			From: issue.Id,
+			To:   id(ref.Repository.Owner.Login, ref.Repository.Name, ref.Number),
+			Type: "mentions",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tracker) processPage(dtos []IssueDTO) error {
+	for _, dto := range dtos {
+		if err := t.processIssue(dto); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchAll fetches every issue in the repository with a concurrency of N
+// parallel page fetches. It mirrors jira.Tracker.FetchAll: the first page
+// establishes the total page count (from GitHub's Link: rel="last" header,
+// the equivalent of JIRA's "total"), then the rest are distributed across N
+// workers. Returns the first error encountered, if any.
+func (t *Tracker) FetchAll(N int) error {
+	first, err := t.fetchPage(1)
+	if err != nil {
+		return err
+	}
+	if err := t.processPage(first); err != nil {
+		return err
+	}
+	if t.total <= 1 {
+		return nil
+	}
+
+	work := make(chan int)
+	done := make(chan bool)
+	var m sync.Mutex
+	var firstErr error
+	for i := 0; i < N; i++ {
+		go func() {
+			for page := range work {
+				dtos, err := t.fetchPage(page)
+				if err == nil {
+					err = t.processPage(dtos)
+				}
+				if err != nil {
+					fmt.Printf("fetch page %d failed: %v\n", page, err)
+					m.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					m.Unlock()
+				}
+			}
+			done <- true
+		}()
+	}
+	for page := 2; page <= t.total; page++ {
+		work <- page
+	}
+	close(work)
+	for i := 0; i < N; i++ {
+		<-done
+	}
+	return firstErr
+}
+
+// GetAll returns the store fetched issues have been written to.
+func (t *Tracker) GetAll() issues.Store {
+	return t.DB
+}
@@ -0,0 +1,297 @@
+// vim: ts=4:sw=4
+
+// Package gitlab implements issues.Tracker against the GitLab REST v4 API,
+// mapping its issues/notes/links model onto the shared
+// issues.Issue/Comment/Link types.
+package gitlab
+
+import (
+	"fmt"
+	"issues"
+	"jsonutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultBaseURL is the API root for gitlab.com; pass a different baseURL
+// to NewTracker to talk to a self-managed GitLab instance instead.
+const DefaultBaseURL = "https://gitlab.com/api/v4"
+
+const DefaultPerPage = 100
+
+// Tracker fetches every issue (and its notes and linked issues) from a
+// single GitLab project.
+type Tracker struct {
+	baseURL   string
+	projectID string // numeric project id, or a plain "namespace/project" path (projectURL escapes it)
+	perPage   int
+	total     int // total page count, discovered from the first page's X-Total-Pages header
+	DB        issues.Store
+	client    *http.Client
+}
+
+// NewTracker creates a Tracker that fetches issues from projectID and
+// writes them to store. client is used for every request, so an
+// authenticated client (see jsonutil.NewBasicAuthClient, with a personal
+// access token as the password) can be passed for private projects; a nil
+// client falls back to http.DefaultClient. baseURL selects the API root;
+// "" defaults to DefaultBaseURL. A nil store defaults to a fresh in-memory
+// issues.Database.
+func NewTracker(baseURL, projectID string, client *http.Client, store issues.Store) *Tracker {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if store == nil {
+		store = issues.NewDatabase()
+	}
+	return &Tracker{
+		baseURL:   baseURL,
+		projectID: projectID,
+		perPage:   DefaultPerPage,
+		DB:        store,
+		client:    client,
+	}
+}
+
+func (t *Tracker) projectURL(path string) string {
+	return fmt.Sprintf("%s/projects/%s%s", t.baseURL, url.PathEscape(t.projectID), path)
+}
+
+// id builds the Id this package uses for an issue: "projectID#iid". Linked
+// issues can belong to a different project than the one a Tracker was
+// created for, so the project id has to be part of the Id, the same way
+// issues/github qualifies ids with "owner/repo".
+func id(projectID string, iid int) issues.Id {
+	return issues.Id(fmt.Sprintf("%s#%d", projectID, iid))
+}
+
+func parseDate(s string) time.Time {
+	// ignore parse errors (returning UNIX time 0 is sufficient); an empty
+	// string (an omitted or null field) is expected to fail to parse
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+// IssueDTO is the shape of an element of GET /projects/:id/issues.
+type IssueDTO struct {
+	IID         int     `json:"iid"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	State       string  `json:"state"`
+	CreatedAt   string  `json:"created_at"`
+	UpdatedAt   string  `json:"updated_at"`
+	Author      UserDTO `json:"author"`
+}
+
+type UserDTO struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+// NoteDTO is the shape of an element of GET .../issues/:iid/notes. System
+// notes (e.g. "changed the description") aren't real comments and are
+// filtered out by processIssue.
+type NoteDTO struct {
+	Body      string  `json:"body"`
+	CreatedAt string  `json:"created_at"`
+	Author    UserDTO `json:"author"`
+	System    bool    `json:"system"`
+}
+
+// LinkedIssueDTO is the shape of an element of GET .../issues/:iid/links.
+// LinkType is "relates_to", "blocks" or "is_blocked_by".
+type LinkedIssueDTO struct {
+	IID       int    `json:"iid"`
+	ProjectID int    `json:"project_id"`
+	LinkType  string `json:"link_type"`
+}
+
+// fetchPage fetches one page of the project's issue list (every state,
+// oldest first). The first page's X-Total-Pages header tells us the total
+// page count, so FetchAll knows how many pages the rest of its workers have
+// to split up -- GitLab issues pages support random access via ?page=, same
+// as JIRA's startAt.
+func (t *Tracker) fetchPage(page int) ([]IssueDTO, error) {
+	params := map[string]string{
+		"scope":    "all",
+		"order_by": "created_at",
+		"sort":     "asc",
+		"per_page": strconv.Itoa(t.perPage),
+		"page":     strconv.Itoa(page),
+	}
+	resp, err := jsonutil.GetResponse(t.client, t.projectURL("/issues"), params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if page == 1 {
+		n, err := strconv.Atoi(resp.Header.Get("X-Total-Pages"))
+		if err != nil {
+			n = 1
+		}
+		t.total = n
+	}
+	var dtos []IssueDTO
+	if err := jsonutil.Decode(resp.Body, &dtos); err != nil {
+		return nil, err
+	}
+	return dtos, nil
+}
+
+// fetchNotes fetches every note on issue iid, across as many pages as it
+// takes.
+func (t *Tracker) fetchNotes(iid int) ([]NoteDTO, error) {
+	var all []NoteDTO
+	for page := 1; ; page++ {
+		var dtos []NoteDTO
+		params := map[string]string{"per_page": strconv.Itoa(t.perPage), "page": strconv.Itoa(page)}
+		if err := jsonutil.Get(t.client, t.projectURL(fmt.Sprintf("/issues/%d/notes", iid)), params, &dtos); err != nil {
+			return nil, err
+		}
+		all = append(all, dtos...)
+		if len(dtos) < t.perPage {
+			return all, nil
+		}
+	}
+}
+
+// fetchLinks fetches issue iid's related/blocks/is_blocked_by issues.
+func (t *Tracker) fetchLinks(iid int) ([]LinkedIssueDTO, error) {
+	var dtos []LinkedIssueDTO
+	if err := jsonutil.Get(t.client, t.projectURL(fmt.Sprintf("/issues/%d/links", iid)), nil, &dtos); err != nil {
+		return nil, err
+	}
+	return dtos, nil
+}
+
+func issueFromDTO(projectID string, dto IssueDTO) issues.Issue {
+	return issues.Issue{
+		Id:       id(projectID, dto.IID),
+		Name:     fmt.Sprintf("#%d", dto.IID),
+		Title:    dto.Title,
+		Body:     dto.Description,
+		Status:   dto.State,
+		Created:  parseDate(dto.CreatedAt),
+		Updated:  parseDate(dto.UpdatedAt),
+		Reporter: dto.Author.Username,
+	}
+}
+
+func commentFromNote(dto NoteDTO) issues.Comment {
+	return issues.Comment{
+		AuthorName: dto.Author.Name,
+		// GitLab's notes API doesn't expose an email address; username is
+		// the closest stable identifier it gives us.
+		AuthorEmail: dto.Author.Username,
+		Created:     parseDate(dto.CreatedAt),
+		Body:        dto.Body,
+	}
+}
+
+// processIssue stores dto and everything hanging off it: its non-system
+// notes (as comments) and its related/blocks/is_blocked_by issues (as
+// typed Links).
+func (t *Tracker) processIssue(dto IssueDTO) error {
+	issue := issueFromDTO(t.projectID, dto)
+
+	notes, err := t.fetchNotes(dto.IID)
+	if err != nil {
+		return err
+	}
+	issue.Comments = make([]issues.Comment, 0, len(notes))
+	for _, n := range notes {
+		if n.System {
+			continue
+		}
+		issue.Comments = append(issue.Comments, commentFromNote(n))
+	}
+	if err := t.DB.UpsertIssue(issue); err != nil {
+		return err
+	}
+
+	links, err := t.fetchLinks(dto.IID)
+	if err != nil {
+		return err
+	}
+	for _, l := range links {
+		linkedProject := t.projectID
+		if l.ProjectID != 0 {
+			linkedProject = strconv.Itoa(l.ProjectID)
+		}
+		if err := t.DB.AddLink(issues.Link{
+			From: issue.Id,
+			To:   id(linkedProject, l.IID),
+			Type: l.LinkType,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tracker) processPage(dtos []IssueDTO) error {
+	for _, dto := range dtos {
+		if err := t.processIssue(dto); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchAll fetches every issue in the project with a concurrency of N
+// parallel page fetches, mirroring jira.Tracker.FetchAll (and
+// issues/github's Tracker): the first page establishes the total page
+// count, then the rest are distributed across N workers. Returns the first
+// error encountered, if any.
+func (t *Tracker) FetchAll(N int) error {
+	first, err := t.fetchPage(1)
+	if err != nil {
+		return err
+	}
+	if err := t.processPage(first); err != nil {
+		return err
+	}
+	if t.total <= 1 {
+		return nil
+	}
+
+	work := make(chan int)
+	done := make(chan bool)
+	var m sync.Mutex
+	var firstErr error
+	for i := 0; i < N; i++ {
+		go func() {
+			for page := range work {
+				dtos, err := t.fetchPage(page)
+				if err == nil {
+					err = t.processPage(dtos)
+				}
+				if err != nil {
+					fmt.Printf("fetch page %d failed: %v\n", page, err)
+					m.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					m.Unlock()
+				}
+			}
+			done <- true
+		}()
+	}
+	for page := 2; page <= t.total; page++ {
+		work <- page
+	}
+	close(work)
+	for i := 0; i < N; i++ {
+		<-done
+	}
+	return firstErr
+}
+
+// GetAll returns the store fetched issues have been written to.
+func (t *Tracker) GetAll() issues.Store {
+	return t.DB
+}
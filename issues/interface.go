@@ -8,7 +8,7 @@ import (
 )
 
 type Tracker interface {
-	GetAll() *Database
+	GetAll() Store
 }
 
 type Id string
@@ -20,18 +20,26 @@ type Link struct {
 	Created time.Time
 }
 
-// Helper for working with JSON objects: type asserts interface to Id
+// ToId type-asserts a decoded interface{} to Id, for Trackers that still
+// have to go through a dynamic map/interface{} for some genuinely
+// unpredictable field instead of a typed struct.
 func ToId(v interface{}) Id {
 	return Id(v.(string))
 }
 
 type Issue struct {
 	Id
-	Title    string
-	Created  time.Time
-	Name     string // eg, "#53" for github and "YARN-499" for JIRA
-	Body     string
-	Comments []Comment
+	Title          string
+	Created        time.Time
+	Updated        time.Time
+	ResolutionDate time.Time
+	Status         string
+	Type           string
+	Assignee       string
+	Reporter       string
+	Name           string // eg, "#53" for github and "YARN-499" for JIRA
+	Body           string
+	Comments       []Comment
 }
 
 // internal function to shorten string representation of potentially large
@@ -66,10 +74,30 @@ func (c Comment) String() string {
 	)
 }
 
+// Store is a sink for a Tracker's output, decoupling collection from how
+// issues end up persisted. Database (below) is the original in-memory/
+// JSON-dump implementation; issues/sqlstore provides a SQL-backed
+// alternative whose normalized tables make SQL-driven analytics (bottleneck
+// reports, cycle-time queries) practical, which a single JSON file isn't.
+type Store interface {
+	UpsertIssue(iss Issue) error
+	SetParent(child, parent Id) error
+	AddLink(l Link) error
+	SetLinkCreated(from, to Id, created time.Time) error
+	IterIssues(fn func(Issue) error) error
+	IterParents(fn func(child, parent Id) error) error
+	IterLinks(fn func(Link) error) error
+	LatestCreated() (time.Time, error)
+	LatestUpdated() (time.Time, error)
+	Stats() (issueCount, parentCount, linkCount int, err error)
+	Close() error
+}
+
 // Database of discovered issues and dependency relationships among them.
 // Maintains a tree for issues organized in a DAG as well as a more general
 // undirected graph (in the form of an adjacency list). Safe to access from
-// multiple goroutines.
+// multiple goroutines. Implements Store, backing it with plain in-memory
+// maps that get JSON-dumped to a single output file.
 type Database struct {
 	Issues map[Id]Issue
 	Tree   map[Id]Id     // map issues to their parents
@@ -86,24 +114,137 @@ func NewDatabase() *Database {
 	}
 }
 
-func (db *Database) AddIssue(iss Issue) {
+func (db *Database) UpsertIssue(iss Issue) error {
 	db.m.Lock()
 	defer db.m.Unlock()
 	db.Issues[iss.Id] = iss
+	return nil
 }
 
 // Add an edge to the tree part of the database
-func (db *Database) SetParent(iss, parent Id) {
+func (db *Database) SetParent(child, parent Id) error {
 	db.m.Lock()
 	defer db.m.Unlock()
-	db.Tree[iss] = parent
+	db.Tree[child] = parent
+	return nil
 }
 
 // Add a directed relationship to the general directed graph of the
-// database. Self-loops are allowed, but uniqueness of the edge is not
-// checked.
-func (db *Database) AddLink(l Link) {
+// database. Self-loops are allowed; a link with the same From/To/Type
+// already recorded is a no-op, so re-adding a link already known from a
+// previous incremental run doesn't grow the graph unboundedly.
+func (db *Database) AddLink(l Link) error {
 	db.m.Lock()
 	defer db.m.Unlock()
+	for _, existing := range db.Graph[l.From] {
+		if existing.To == l.To && existing.Type == l.Type {
+			return nil
+		}
+	}
 	db.Graph[l.From] = append(db.Graph[l.From], l)
+	return nil
+}
+
+// SetLinkCreated fills in the Created date of every link from -> to, once
+// it's discovered later (from changelog history rather than the initial
+// issuelinks field).
+func (db *Database) SetLinkCreated(from, to Id, created time.Time) error {
+	db.m.Lock()
+	defer db.m.Unlock()
+	for i, link := range db.Graph[from] {
+		if link.To == to {
+			db.Graph[from][i].Created = created
+		}
+	}
+	return nil
+}
+
+func (db *Database) IterIssues(fn func(Issue) error) error {
+	db.m.Lock()
+	snapshot := make([]Issue, 0, len(db.Issues))
+	for _, iss := range db.Issues {
+		snapshot = append(snapshot, iss)
+	}
+	db.m.Unlock()
+	for _, iss := range snapshot {
+		if err := fn(iss); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *Database) IterParents(fn func(child, parent Id) error) error {
+	db.m.Lock()
+	type pair struct{ child, parent Id }
+	snapshot := make([]pair, 0, len(db.Tree))
+	for child, parent := range db.Tree {
+		snapshot = append(snapshot, pair{child, parent})
+	}
+	db.m.Unlock()
+	for _, p := range snapshot {
+		if err := fn(p.child, p.parent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *Database) IterLinks(fn func(Link) error) error {
+	db.m.Lock()
+	var snapshot []Link
+	for _, links := range db.Graph {
+		snapshot = append(snapshot, links...)
+	}
+	db.m.Unlock()
+	for _, l := range snapshot {
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LatestCreated returns the most recent Created timestamp among all issues
+// in the database, or the zero Time if the database is empty.
+func (db *Database) LatestCreated() (time.Time, error) {
+	db.m.Lock()
+	defer db.m.Unlock()
+	var latest time.Time
+	for _, iss := range db.Issues {
+		if iss.Created.After(latest) {
+			latest = iss.Created
+		}
+	}
+	return latest, nil
+}
+
+// LatestUpdated returns the most recent Updated timestamp among all issues
+// in the database, or the zero Time if the database is empty.
+func (db *Database) LatestUpdated() (time.Time, error) {
+	db.m.Lock()
+	defer db.m.Unlock()
+	var latest time.Time
+	for _, iss := range db.Issues {
+		if iss.Updated.After(latest) {
+			latest = iss.Updated
+		}
+	}
+	return latest, nil
+}
+
+func (db *Database) Stats() (issueCount, parentCount, linkCount int, err error) {
+	db.m.Lock()
+	defer db.m.Unlock()
+	issueCount = len(db.Issues)
+	parentCount = len(db.Tree)
+	for _, links := range db.Graph {
+		linkCount += len(links)
+	}
+	return
+}
+
+// Close is a no-op: Database has no underlying connection to release.
+func (db *Database) Close() error {
+	return nil
 }
@@ -0,0 +1,54 @@
+// vim: ts=4:sw=4
+package issues
+
+import "testing"
+
+func TestUpsertIssueRoundTrip(t *testing.T) {
+	db := NewDatabase()
+	iss := Issue{Id: "PROJ-1", Title: "first title"}
+	if err := db.UpsertIssue(iss); err != nil {
+		t.Fatalf("UpsertIssue: %v", err)
+	}
+
+	iss.Title = "updated title"
+	if err := db.UpsertIssue(iss); err != nil {
+		t.Fatalf("UpsertIssue (update): %v", err)
+	}
+
+	got, ok := db.Issues["PROJ-1"]
+	if !ok {
+		t.Fatalf("issue PROJ-1 not found after UpsertIssue")
+	}
+	if got.Title != "updated title" {
+		t.Errorf("got title %q, want %q", got.Title, "updated title")
+	}
+
+	issueCount, _, _, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if issueCount != 1 {
+		t.Errorf("issueCount = %d, want 1 (upsert of the same Id should not duplicate)", issueCount)
+	}
+}
+
+func TestAddLinkDedup(t *testing.T) {
+	db := NewDatabase()
+	l := Link{From: "PROJ-1", To: "PROJ-2", Type: "relates"}
+	if err := db.AddLink(l); err != nil {
+		t.Fatalf("AddLink: %v", err)
+	}
+	if err := db.AddLink(l); err != nil {
+		t.Fatalf("AddLink (repeat): %v", err)
+	}
+	if got, want := len(db.Graph["PROJ-1"]), 1; got != want {
+		t.Errorf("len(Graph[PROJ-1]) = %d, want %d (re-adding an identical link should be a no-op)", got, want)
+	}
+
+	if err := db.AddLink(Link{From: "PROJ-1", To: "PROJ-2", Type: "blocks"}); err != nil {
+		t.Fatalf("AddLink (different type): %v", err)
+	}
+	if got, want := len(db.Graph["PROJ-1"]), 2; got != want {
+		t.Errorf("len(Graph[PROJ-1]) = %d, want %d (a different link type is not a duplicate)", got, want)
+	}
+}
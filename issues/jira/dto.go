@@ -0,0 +1,94 @@
+// vim: ts=4:sw=4
+package jira
+
+// Typed shapes for JIRA's /rest/api/latest/search response (with
+// expand=changelog), decoded with jsonutil.Decode instead of walking a
+// map[string]interface{} tree. Only the fields this package reads are
+// given names; everything else is silently dropped by encoding/json.
+
+// SearchResponse is the envelope /search returns. GetFrom never decodes one
+// of these directly -- it streams the "issues" array with streamIssues
+// instead, to avoid holding a whole page of issues in memory at once -- but
+// the type documents the shape a non-streaming caller would see.
+type SearchResponse struct {
+	StartAt    int        `json:"startAt"`
+	MaxResults int        `json:"maxResults"`
+	Total      int        `json:"total"`
+	Issues     []IssueDTO `json:"issues"`
+}
+
+type IssueDTO struct {
+	Id        string       `json:"id"`
+	Key       string       `json:"key"`
+	Fields    FieldsDTO    `json:"fields"`
+	Changelog ChangelogDTO `json:"changelog"`
+}
+
+type FieldsDTO struct {
+	Summary        string         `json:"summary"`
+	Description    string         `json:"description"`
+	Created        string         `json:"created"`
+	Updated        string         `json:"updated"`
+	ResolutionDate string         `json:"resolutiondate"`
+	Status         *NamedDTO      `json:"status"`
+	IssueType      *NamedDTO      `json:"issuetype"`
+	Assignee       *UserDTO       `json:"assignee"`
+	Reporter       *UserDTO       `json:"reporter"`
+	Parent         *ParentDTO     `json:"parent"`
+	Comment        CommentPageDTO `json:"comment"`
+	IssueLinks     []IssueLinkDTO `json:"issuelinks"`
+}
+
+// NamedDTO covers the JIRA fields (status, issuetype) that are objects with
+// just a "name" worth keeping.
+type NamedDTO struct {
+	Name string `json:"name"`
+}
+
+type UserDTO struct {
+	DisplayName  string `json:"displayName"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+type ParentDTO struct {
+	Id string `json:"id"`
+}
+
+type CommentPageDTO struct {
+	MaxResults int          `json:"maxResults"`
+	Comments   []CommentDTO `json:"comments"`
+}
+
+type CommentDTO struct {
+	Created string  `json:"created"`
+	Body    string  `json:"body"`
+	Author  UserDTO `json:"author"`
+}
+
+type IssueLinkDTO struct {
+	Id          string           `json:"id"`
+	Type        IssueLinkTypeDTO `json:"type"`
+	InwardIssue *LinkedIssueDTO  `json:"inwardIssue"`
+}
+
+type IssueLinkTypeDTO struct {
+	Inward string `json:"inward"`
+}
+
+type LinkedIssueDTO struct {
+	Id string `json:"id"`
+}
+
+type ChangelogDTO struct {
+	Histories []HistoryDTO `json:"histories"`
+}
+
+type HistoryDTO struct {
+	Created string           `json:"created"`
+	Items   []HistoryItemDTO `json:"items"`
+}
+
+type HistoryItemDTO struct {
+	Field string  `json:"field"`
+	To    *string `json:"to"`
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"issues"
 	"jsonutil"
+	"net/http"
+	"sort"
 	"sync"
 	"time"
 )
@@ -70,22 +72,74 @@ type Tracker struct {
 	baseURL         string
 	total           int
 	maxResults      int
-	DB              *issues.Database
+	DB              issues.Store
 	issueLinks      *stringSet // set of issue links (by link id) scraped
 	createdDatesSet *createdDatesSet
+	jql             string // JQL clause used for every search
+	client          *http.Client
 }
 
-func NewTracker(url string) (t *Tracker) {
+// NewTracker creates a Tracker that talks to the JIRA instance at url and
+// writes every issue/link it discovers to store. client is used for every
+// request, so an authenticated client (see
+// jsonutil.NewBasicAuthClient/NewOAuth1Client) can be passed for private or
+// rate-limited instances; a nil client falls back to http.DefaultClient. A
+// nil store defaults to a fresh in-memory issues.Database.
+func NewTracker(url string, client *http.Client, store issues.Store) (t *Tracker) {
+	if store == nil {
+		store = issues.NewDatabase()
+	}
 	t = &Tracker{
 		baseURL:         url,
 		maxResults:      InitialMaxResults,
-		DB:              issues.NewDatabase(),
+		DB:              store,
 		issueLinks:      newStringSet(),
 		createdDatesSet: newCreatedDatesSet(),
+		jql:             "ORDER BY Created Asc",
+		client:          client,
+	}
+	return
+}
+
+// NewIncrementalTracker creates a Tracker that only searches for issues
+// created (or, with incremental == "updated", updated) at or after the
+// watermark recorded in state. A state with no watermark (as returned by
+// LoadTrackerState for a state file that doesn't exist yet) falls back to
+// fetching everything, same as NewTracker.
+func NewIncrementalTracker(url string, client *http.Client, store issues.Store, incremental string, state *TrackerState) (t *Tracker) {
+	t = NewTracker(url, client, store)
+	t.jql = buildJQL(incremental, state.LastSuccess)
+	if state.MaxResults > 0 {
+		t.maxResults = state.MaxResults
 	}
 	return
 }
 
+// buildJQL produces the JQL clause for an incremental fetch: unfiltered if
+// there's no prior watermark, otherwise restricted to issues created (or
+// updated) since that watermark.
+func buildJQL(incremental string, since time.Time) string {
+	if since.IsZero() {
+		return "ORDER BY Created Asc"
+	}
+	field := "created"
+	if incremental == "updated" {
+		field = "updated"
+	}
+	return fmt.Sprintf(`%s >= "%s" ORDER BY Created Asc`, field, since.Format(JQLDateFormat))
+}
+
+// JQL returns the JQL clause this Tracker searches with.
+func (t *Tracker) JQL() string {
+	return t.jql
+}
+
+// MaxResults returns the page size this Tracker is currently using, which
+// may have been adjusted from InitialMaxResults based on server responses.
+func (t *Tracker) MaxResults() int {
+	return t.maxResults
+}
+
 func (t *Tracker) url(path string) string {
 	return t.baseURL + "/rest/api/latest" + path
 }
@@ -93,9 +147,13 @@ func (t *Tracker) url(path string) string {
 // The JSON date format used by the JIRA API
 const DateFormat = "2006-01-02T15:04:05.000-0700"
 
-func getDate(m map[string]interface{}, fieldname string) time.Time {
-	// ignore parse errors (returning UNIX time 0 is sufficient)
-	t, _ := time.Parse(DateFormat, jsonutil.GetString(m, fieldname))
+// The date literal format JQL comparisons (e.g. "created >= ...") expect.
+const JQLDateFormat = "2006-01-02 15:04"
+
+func parseDate(s string) time.Time {
+	// ignore parse errors (returning UNIX time 0 is sufficient); an empty
+	// string (an omitted or null field) is expected to fail to parse
+	t, _ := time.Parse(DateFormat, s)
 	return t
 }
 
@@ -103,204 +161,284 @@ func (t *Tracker) Search(start int) (params map[string]string) {
 	// provide a capacity hint to avoid excessive reallocs; a new map is
 	// used to make searches safe for multiple goroutines
 	params = make(map[string]string, 5)
-	params["jql"] = "ORDER BY Created Asc"
+	params["jql"] = t.jql
 	params["startAt"] = fmt.Sprintf("%d", start)
 	params["maxResults"] = fmt.Sprintf("%d", t.maxResults)
 	return params
 }
 
-func (t *Tracker) AddIssueLink(from issues.Id, link map[string]interface{}) {
-	id := jsonutil.GetString(link, "id")
+func (t *Tracker) AddIssueLink(from issues.Id, link IssueLinkDTO) {
 	// if already processed, ignore
-	if t.issueLinks.Contains(id) {
+	if t.issueLinks.Contains(link.Id) {
 		return
 	}
-	if _, ok := link["inwardIssue"]; ok {
-		typeInfo := jsonutil.GetMap(link["type"])
-		linkType := jsonutil.GetString(typeInfo, "inward")
-		other := jsonutil.GetMap(link["inwardIssue"])
-		t.DB.AddLink(
-			issues.Link{
-				From: from,
-				To:   issues.ToId(other["id"]),
-				Type: linkType,
-			},
-		)
-	}
-	t.issueLinks.Add(id)
+	if link.InwardIssue != nil {
+		if err := t.DB.AddLink(issues.Link{
+			From: from,
+			To:   issues.Id(link.InwardIssue.Id),
+			Type: link.Type.Inward,
+		}); err != nil {
+			fmt.Printf("could not store link: %v\n", err)
+		}
+	}
+	t.issueLinks.Add(link.Id)
 }
 
 // Fetch all issues from JIRA with a concurrency of N parallel fetches.
-func (t *Tracker) FetchAll(N int) {
-	err := t.GetFrom(0)
+// Returns an error if any page is still failing after a retry pass --
+// callers that persist an incremental watermark must not advance it when
+// FetchAll returns an error, since some page of the batch may not have been
+// fetched.
+func (t *Tracker) FetchAll(N int) error {
+	// firstBatchEnd is how many issues the first page itself held -- not
+	// t.DB.Stats()'s cumulative issue count, which also counts whatever
+	// the store already held from a previous run (a loaded JSON file, or
+	// a SQLite/postgres store, neither of which is cleared between runs).
+	// Reading the page-1 size back out of that cumulative count would
+	// make a non-empty store look like it already covered the whole
+	// result set after just one page.
+	firstBatchEnd, err := t.GetFrom(0)
 	if err != nil {
 		fmt.Println("initial fetch failed", err)
+		return err
 	}
-	// check if the first search returned all the results
-	firstBatchEnd := len(t.DB.Issues)
 	if firstBatchEnd >= t.total {
-		return
+		t.addCreatedDates()
+		return nil
 	}
+
+	starts := make([]int, 0, (t.total-firstBatchEnd)/t.maxResults+1)
+	for start := firstBatchEnd; start < t.total; start += t.maxResults {
+		starts = append(starts, start)
+	}
+
+	failed := t.fetchStarts(starts, N)
+	if len(failed) > 0 {
+		fmt.Printf("retrying %d page(s) that failed on the first pass: %v\n", len(failed), failed)
+		failed = t.fetchStarts(failed, N)
+	}
+
+	t.addCreatedDates()
+	if len(failed) > 0 {
+		return fmt.Errorf("jira: %d page(s) still failing after retry: %v", len(failed), failed)
+	}
+	return nil
+}
+
+// fetchStarts fetches every start in starts with a concurrency of N,
+// queuing any that fail onto a retry channel drained once all N workers
+// are done, and returns those failed starts -- so a transient failure at
+// some high offset doesn't leave a permanent hole in the database, as long
+// as the caller retries what's returned (as FetchAll does, once).
+func (t *Tracker) fetchStarts(starts []int, N int) (failed []int) {
 	work := make(chan int)
+	retry := make(chan int, len(starts))
 	done := make(chan bool)
 	for i := 0; i < N; i++ {
 		go func() {
 			for start := range work {
-				err = t.GetFrom(start)
-				if err != nil {
+				if _, err := t.GetFrom(start); err != nil {
 					fmt.Printf("fetch from %d failed: %v\n", start, err)
+					retry <- start
+					continue
 				}
 				t.PrintParams()
 			}
 			done <- true
 		}()
 	}
-	for start := firstBatchEnd; start < t.total; start += t.maxResults {
+	for _, start := range starts {
 		work <- start
 	}
 	close(work)
 	for i := 0; i < N; i++ {
 		<-done
 	}
-	t.addCreatedDates()
+	close(retry)
+	for start := range retry {
+		failed = append(failed, start)
+	}
+	sort.Ints(failed)
+	return failed
 }
 
-// Get the database fetched so far.
-func (t *Tracker) GetAll() *issues.Database {
+// Get the store fetched issues have been written to.
+func (t *Tracker) GetAll() issues.Store {
 	return t.DB
 }
 
-func parseComment(commentInterface interface{}) issues.Comment {
-	comment := issues.Comment{}
-	commentMap := jsonutil.GetMap(commentInterface)
-	comment.Created = getDate(commentMap, "created")
-	comment.Body = jsonutil.GetString(commentMap, "body")
-	author := jsonutil.GetMap(commentMap["author"])
-	comment.AuthorName = jsonutil.GetString(author, "displayName")
-	comment.AuthorEmail = jsonutil.GetString(author, "emailAddress")
-	return comment
+func commentFromDTO(dto CommentDTO) issues.Comment {
+	return issues.Comment{
+		AuthorName:  dto.Author.DisplayName,
+		AuthorEmail: dto.Author.EmailAddress,
+		Created:     parseDate(dto.Created),
+		Body:        dto.Body,
+	}
 }
 
-func parseIssue(issueInterface interface{}) issues.Issue {
-	issueMap := jsonutil.GetMap(issueInterface)
+func issueFromDTO(dto IssueDTO) issues.Issue {
 	issue := issues.Issue{}
-	issue.Id = issues.ToId(issueMap["id"])
-	issue.Name = jsonutil.GetString(issueMap, "key")
-
-	// Base fields
-	fields := jsonutil.GetMap(issueMap["fields"])
-	issue.Created = getDate(fields, "created")
-	issue.Title = jsonutil.GetString(fields, "summary")
-	issue.Body = jsonutil.GetString(fields, "description")
-
-	// Comments
-	commentInfo := jsonutil.GetMap(fields["comment"])
-	issue.Comments = make([]issues.Comment, 0,
-		int(commentInfo["maxResults"].(float64)))
-	comments := commentInfo["comments"].([]interface{})
-	for _, commentInterface := range comments {
-		comment := parseComment(commentInterface)
-		issue.Comments = append(issue.Comments, comment)
+	issue.Id = issues.Id(dto.Id)
+	issue.Name = dto.Key
+
+	f := dto.Fields
+	issue.Created = parseDate(f.Created)
+	issue.Updated = parseDate(f.Updated)
+	issue.ResolutionDate = parseDate(f.ResolutionDate)
+	issue.Title = f.Summary
+	issue.Body = f.Description
+	if f.Status != nil {
+		issue.Status = f.Status.Name
+	}
+	if f.IssueType != nil {
+		issue.Type = f.IssueType.Name
+	}
+	if f.Assignee != nil {
+		issue.Assignee = f.Assignee.DisplayName
+	}
+	if f.Reporter != nil {
+		issue.Reporter = f.Reporter.DisplayName
+	}
+
+	issue.Comments = make([]issues.Comment, 0, len(f.Comment.Comments))
+	for _, c := range f.Comment.Comments {
+		issue.Comments = append(issue.Comments, commentFromDTO(c))
 	}
 	return issue
 }
 
-func (t *Tracker) parseChangelog(from issues.Id, changelogInterface interface{}) {
-	changelog := jsonutil.GetMap(changelogInterface)
-	histories := changelog["histories"].([]interface{})
+func (t *Tracker) parseChangelog(from issues.Id, changelog ChangelogDTO) {
 	// connects link to keys to created dates (all links have a fixed from id)
 	createdDates := t.createdDatesSet
-	for _, historyInterface := range histories {
-		history := jsonutil.GetMap(historyInterface)
-		items := history["items"].([]interface{})
-		for _, itemInterface := range items {
-			item := jsonutil.GetMap(itemInterface)
+	for _, history := range changelog.Histories {
+		created := parseDate(history.Created)
+		for _, item := range history.Items {
 			// skip history items that don't concern links
-			if jsonutil.GetString(item, "field") != "Link" {
+			if item.Field != "Link" || item.To == nil {
 				continue
 			}
-			created := getDate(history, "created")
-			if item["to"] == nil {
-				continue
-			}
-			toKey := jsonutil.GetString(item, "to")
-			createdDates.addDate(from, toKey, created)
+			createdDates.addDate(from, *item.To, created)
 		}
 	}
 }
 
+// addCreatedDates fills in the Created date of links discovered via
+// parseChangelog, which only learns of a link's target by its issue key
+// (e.g. "YARN-499") rather than the id SetLinkCreated needs -- so the first
+// pass builds a key->id lookup over every known issue.
 func (t *Tracker) addCreatedDates() {
-	keyLookup := make(map[issues.Id]string, len(t.DB.Graph))
-	for _, links := range t.DB.Graph {
-		for _, link := range links {
-			if iss, ok := t.DB.Issues[link.To]; ok {
-				keyLookup[iss.Id] = iss.Name
-			}
-		}
+	keyToId := make(map[string]issues.Id)
+	if err := t.DB.IterIssues(func(iss issues.Issue) error {
+		keyToId[iss.Name] = iss.Id
+		return nil
+	}); err != nil {
+		fmt.Printf("could not look up issue keys: %v\n", err)
+		return
 	}
 	t.createdDatesSet.m.Lock()
 	defer t.createdDatesSet.m.Unlock()
 	for fromId, toDates := range t.createdDatesSet.dates {
-		for i, link := range t.DB.Graph[fromId] {
-			if date, ok := toDates[keyLookup[link.To]]; ok {
-				link.Created = date
-				t.DB.Graph[fromId][i] = link
+		for toKey, created := range toDates {
+			toId, ok := keyToId[toKey]
+			if !ok {
+				continue
+			}
+			if err := t.DB.SetLinkCreated(fromId, toId, created); err != nil {
+				fmt.Printf("could not set link created date: %v\n", err)
 			}
 		}
 		delete(t.createdDatesSet.dates, fromId)
 	}
 }
 
-// Get issues starting from a particular search result number.
-func (t *Tracker) GetFrom(start int) (err error) {
+// Get issues starting from a particular search result number. The response
+// is streamed and decoded one issue at a time via streamIssues, rather than
+// being fully materialized first, so a large page never needs to fit in
+// memory twice over. count is how many issues this page actually held --
+// callers that want "size of this page" should use it rather than reading
+// t.DB.Stats() afterward, since t.DB may be a store that already held
+// issues from a previous run.
+func (t *Tracker) GetFrom(start int) (count int, err error) {
 	params := t.Search(start)
 	// filter the list of fields -- only affects the fields map; in particular,
 	// id, key and self (a URL for the issue resource) are always returned
 	params["fields"] =
-		"summary,description,comment,parent,issuelinks,created"
+		"summary,description,comment,parent,issuelinks,created,updated," +
+			"resolutiondate,status,issuetype,assignee,reporter"
 	params["expand"] = "changelog"
-	r, err := jsonutil.Get(t.url("/search"), params)
+	body, err := jsonutil.GetReader(t.client, t.url("/search"), params)
 	if err != nil {
-		return
+		return 0, err
 	}
-	if _, ok := r["maxResults"]; ok {
-		t.maxResults = int(r["maxResults"].(float64))
-	}
-	if t.total == 0 {
-		t.total = int(r["total"].(float64))
+	defer body.Close()
+
+	meta, issueCh, err := streamIssues(body)
+	if err != nil {
+		return 0, err
 	}
 	db := t.DB
-	issueList := r["issues"].([]interface{})
-	for _, issueInterface := range issueList {
-		issue := parseIssue(issueInterface)
-		db.AddIssue(issue)
-
-		// Links
-		issueMap := jsonutil.GetMap(issueInterface)
-		fields := jsonutil.GetMap(issueMap["fields"])
-
-		// parent links
-		if _, ok := fields["parent"]; ok {
-			parentInfo := jsonutil.GetMap(fields["parent"])
-			db.SetParent(issue.Id, issues.ToId(parentInfo["id"]))
+	for res := range issueCh {
+		if err != nil {
+			// Already failed on an earlier issue in this page; keep
+			// draining so streamIssueArray's producer goroutine (blocked
+			// sending on an unbuffered channel) isn't left stranded
+			// forever waiting for a reader that already gave up.
+			continue
+		}
+		if res.Err != nil {
+			err = res.Err
+			continue
+		}
+		dto := res.Issue
+		issue := issueFromDTO(dto)
+		if e := db.UpsertIssue(issue); e != nil {
+			err = e
+			continue
+		}
+		count++
+
+		if dto.Fields.Parent != nil {
+			if e := db.SetParent(issue.Id, issues.Id(dto.Fields.Parent.Id)); e != nil {
+				err = e
+				continue
+			}
 		}
 
-		// general links
-		for _, issueLinkInterface := range fields["issuelinks"].([]interface{}) {
-			link := jsonutil.GetMap(issueLinkInterface)
+		for _, link := range dto.Fields.IssueLinks {
 			t.AddIssueLink(issue.Id, link)
 		}
 
 		// history (for link creation dates)
-		t.parseChangelog(issue.Id, issueMap["changelog"])
+		t.parseChangelog(issue.Id, dto.Changelog)
 	}
-	return
+	if err != nil {
+		return 0, err
+	}
+
+	// JIRA clamps maxResults server-side (e.g. a "summary,comment,..."
+	// fields list with long changelogs can be more expensive per issue
+	// than the requested page size allows); when that happens, shrink the
+	// page size for every subsequent request instead of continuing to ask
+	// for a size the server won't honor anyway.
+	if meta.MaxResults > 0 && meta.MaxResults < t.maxResults {
+		fmt.Printf("server truncated page size: maxResults %d -> %d\n", t.maxResults, meta.MaxResults)
+		t.maxResults = meta.MaxResults
+	}
+	if t.total == 0 {
+		t.total = meta.Total
+	}
+	return count, nil
 }
 
 // For debugging purposes
 func (t *Tracker) PrintParams() {
+	issueCount, _, _, err := t.DB.Stats()
+	if err != nil {
+		fmt.Printf("could not read store stats: %v\n", err)
+		return
+	}
 	fmt.Printf("finished: %d total: %d maxResults: %d\n",
-		len(t.DB.Issues),
+		issueCount,
 		t.total,
 		t.maxResults)
 }
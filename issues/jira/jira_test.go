@@ -0,0 +1,23 @@
+// vim: ts=4:sw=4
+package jira
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildJQL(t *testing.T) {
+	if got, want := buildJQL("created", time.Time{}), "ORDER BY Created Asc"; got != want {
+		t.Errorf("buildJQL with zero watermark = %q, want %q", got, want)
+	}
+
+	since := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if got, want := buildJQL("created", since),
+		`created >= "2024-03-01 12:00" ORDER BY Created Asc`; got != want {
+		t.Errorf("buildJQL(created) = %q, want %q", got, want)
+	}
+	if got, want := buildJQL("updated", since),
+		`updated >= "2024-03-01 12:00" ORDER BY Created Asc`; got != want {
+		t.Errorf("buildJQL(updated) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,70 @@
+// vim: ts=4:sw=4
+package jira
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// StateSchemaVersion is bumped whenever the TrackerState layout changes, so
+// a future version of this package can migrate old state files instead of
+// misreading them.
+const StateSchemaVersion = 1
+
+// TrackerState is the persisted watermark for a single (baseURL, JQL) pair.
+// Saving it after a successful FetchAll lets a later run resume an
+// incremental fetch instead of starting from zero.
+type TrackerState struct {
+	Version     int       `json:"version"`
+	BaseURL     string    `json:"base_url"`
+	JQL         string    `json:"jql"`
+	Incremental string    `json:"incremental"` // "created" or "updated"
+	LastSuccess time.Time `json:"last_success"`
+	MaxResults  int       `json:"max_results"`
+}
+
+// StateStore is an optional capability a Store can implement to persist
+// TrackerState itself (e.g. sqlstore.Store, in its collector_state table)
+// instead of Save's side JSON file. loadState/saveState in issues/scraper
+// use this when it's available, so -store=sqlite doesn't need a separate
+// -state file alongside the database.
+type StateStore interface {
+	LoadState() (TrackerState, error)
+	SaveState(TrackerState) error
+}
+
+// LoadTrackerState reads state from path. A missing file is not an error --
+// it produces a state with only Version set (no watermark), so callers can
+// use it to start a fresh incremental fetch.
+func LoadTrackerState(path string) (*TrackerState, error) {
+	s := &TrackerState{Version: StateSchemaVersion}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	if err := dec.Decode(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save writes state to path, overwriting any existing file. Callers must
+// only call Save once a fetch has fully succeeded -- a partial failure
+// inside FetchAll must not advance the watermark.
+func (s *TrackerState) Save(path string) error {
+	s.Version = StateSchemaVersion
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
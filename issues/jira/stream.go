@@ -0,0 +1,98 @@
+// vim: ts=4:sw=4
+package jira
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// searchMeta is the pagination info that accompanies a page of issues.
+type searchMeta struct {
+	StartAt    int
+	MaxResults int
+	Total      int
+}
+
+// issueOrErr is one element streamed off streamIssues' channel: either a
+// decoded issue, or the error that ended the stream early.
+type issueOrErr struct {
+	Issue IssueDTO
+	Err   error
+}
+
+// streamIssues decodes a /search response body token-by-token, so the
+// issues in a page are handed to the caller one at a time instead of being
+// materialized into a single large slice -- a 250-issue page with long
+// changelogs is easily tens of MB fully decoded. meta is only safe to read
+// once the returned channel has been drained: it's populated by the
+// goroutine feeding the channel, and that write happens-before the
+// channel's close, which happens-before a range loop over it returns.
+func streamIssues(r io.Reader) (meta *searchMeta, issuesCh <-chan issueOrErr, err error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return nil, nil, fmt.Errorf("jira: expected a JSON object, got %v", tok)
+	}
+	meta = &searchMeta{}
+	out := make(chan issueOrErr)
+	go func() {
+		defer close(out)
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				out <- issueOrErr{Err: err}
+				return
+			}
+			key, ok := keyTok.(string)
+			if !ok {
+				out <- issueOrErr{Err: fmt.Errorf("jira: expected a string key, got %v", keyTok)}
+				return
+			}
+			var decodeErr error
+			switch key {
+			case "startAt":
+				decodeErr = dec.Decode(&meta.StartAt)
+			case "maxResults":
+				decodeErr = dec.Decode(&meta.MaxResults)
+			case "total":
+				decodeErr = dec.Decode(&meta.Total)
+			case "issues":
+				decodeErr = streamIssueArray(dec, out)
+			default:
+				var discard interface{}
+				decodeErr = dec.Decode(&discard)
+			}
+			if decodeErr != nil {
+				out <- issueOrErr{Err: decodeErr}
+				return
+			}
+		}
+	}()
+	return meta, out, nil
+}
+
+// streamIssueArray decodes the "issues" array, sending each element on out
+// as soon as it's decoded rather than collecting them into a slice first.
+func streamIssueArray(dec *json.Decoder, out chan<- issueOrErr) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf(`jira: expected "issues" to be an array, got %v`, tok)
+	}
+	for dec.More() {
+		var dto IssueDTO
+		if err := dec.Decode(&dto); err != nil {
+			return err
+		}
+		out <- issueOrErr{Issue: dto}
+	}
+	_, err = dec.Token() // consume the closing ']'
+	return err
+}
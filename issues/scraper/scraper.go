@@ -5,45 +5,306 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"issues"
+	"issues/github"
+	"issues/gitlab"
 	"issues/jira"
+	"issues/sqlstore"
+	"jsonutil"
+	"net/http"
 	"os"
 	"time"
 )
 
+// defaultJiraURL is both the -url flag's default and the sentinel this
+// package checks for to know whether the user actually set -url, so a
+// github/gitlab backend can fall back to its own default API root instead
+// of trying to hit a JIRA instance.
+const defaultJiraURL = "https://issues.apache.org/jira"
+
+// fetcher is the common surface every backend's Tracker needs to provide
+// for main's fetch-then-report loop; jira.Tracker additionally exposes
+// JQL/MaxResults for the incremental-state bookkeeping below, which only it
+// supports today.
+type fetcher interface {
+	FetchAll(N int) error
+	GetAll() issues.Store
+}
+
+// newClient builds the *http.Client used for every request, based on the
+// -auth flag group, then layers rate limiting and retry on top if rps > 0
+// (see jsonutil.NewRateLimitedClient) -- every retry still goes through the
+// auth layer underneath, so a retried request is still correctly signed.
+func newClient(auth, user, pass, ckey, pkey, tokenCache, baseURL string, rps float64, burst, retries int) (*http.Client, error) {
+	var client *http.Client
+	switch auth {
+	case "":
+		client = nil
+	case "basic":
+		client = jsonutil.NewBasicAuthClient(nil, user, pass)
+	case "oauth":
+		key, err := jsonutil.LoadPrivateKey(pkey)
+		if err != nil {
+			return nil, err
+		}
+		cfg := &jsonutil.OAuth1Config{
+			BaseURL:     baseURL,
+			ConsumerKey: ckey,
+			PrivateKey:  key,
+			TokenCache:  tokenCache,
+		}
+		client, err = jsonutil.NewOAuth1Client(nil, cfg)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown -auth %q (want basic or oauth)", auth)
+	}
+	if rps > 0 {
+		client = jsonutil.NewRateLimitedClient(client, jsonutil.NewLimiter(rps, burst), retries)
+	}
+	return client, nil
+}
+
+// loadDatabase loads a previously saved database from path, or returns a
+// fresh one if path doesn't exist yet (e.g. the first run).
+func loadDatabase(path string) (*issues.Database, error) {
+	db := issues.NewDatabase()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	if err := dec.Decode(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// newStore builds the issues.Store used for the fetch, based on the -store
+// flag. For "json", jsonDB is also returned (non-nil) so the caller can
+// JSON-encode it to outputFile afterwards; for the SQL-backed stores,
+// results are already persisted as they're written, so jsonDB is nil.
+func newStore(kind, outputFile, dsn string) (store issues.Store, jsonDB *issues.Database, err error) {
+	switch kind {
+	case "json":
+		jsonDB, err = loadDatabase(outputFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return jsonDB, jsonDB, nil
+	case "sqlite":
+		path := dsn
+		if path == "" {
+			path = outputFile
+		}
+		store, err = sqlstore.Open("sqlite3", path)
+		return store, nil, err
+	case "postgres":
+		store, err = sqlstore.Open("postgres", dsn)
+		return store, nil, err
+	default:
+		return nil, nil, fmt.Errorf("unknown -store %q (want json, sqlite or postgres)", kind)
+	}
+}
+
+// loadState loads incremental state for -state: from store itself if it
+// implements jira.StateStore (e.g. -store=sqlite, which persists it in the
+// collector_state table instead of a side file), otherwise from the JSON
+// file at statePath.
+func loadState(store issues.Store, statePath string) (*jira.TrackerState, error) {
+	if ss, ok := store.(jira.StateStore); ok {
+		st, err := ss.LoadState()
+		if err != nil {
+			return nil, err
+		}
+		if st.Version == 0 {
+			st.Version = jira.StateSchemaVersion
+		}
+		return &st, nil
+	}
+	return jira.LoadTrackerState(statePath)
+}
+
+// saveState is loadState's write-side counterpart.
+func saveState(store issues.Store, statePath string, state *jira.TrackerState) error {
+	if ss, ok := store.(jira.StateStore); ok {
+		return ss.SaveState(*state)
+	}
+	return state.Save(statePath)
+}
+
+// newTracker builds the fetcher for the selected -backend. For "jira", the
+// concrete *jira.Tracker is also returned (non-nil) so main can save
+// incremental state afterwards; the other backends don't support that yet,
+// so it's nil for them.
+func newTracker(backend, baseURL string, client *http.Client, store issues.Store,
+	statePath, incremental, ghOwner, ghRepo, glProject string) (t fetcher, jiraTracker *jira.Tracker, err error) {
+	switch backend {
+	case "jira":
+		if statePath != "" {
+			state, err := loadState(store, statePath)
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not load state: %w", err)
+			}
+			jiraTracker = jira.NewIncrementalTracker(baseURL, client, store, incremental, state)
+		} else {
+			jiraTracker = jira.NewTracker(baseURL, client, store)
+		}
+		return jiraTracker, jiraTracker, nil
+	case "github":
+		if ghOwner == "" || ghRepo == "" {
+			return nil, nil, fmt.Errorf("-backend=github requires -owner and -repo")
+		}
+		return github.NewTracker(baseURL, ghOwner, ghRepo, client, store), nil, nil
+	case "gitlab":
+		if glProject == "" {
+			return nil, nil, fmt.Errorf("-backend=gitlab requires -project")
+		}
+		return gitlab.NewTracker(baseURL, glProject, client, store), nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown -backend %q (want jira, github or gitlab)", backend)
+	}
+}
+
 func main() {
 	var baseURL string
 	var debug bool
 	var N int
 	var outputFile string
-	flag.StringVar(&baseURL, "url", "https://issues.apache.org/jira", "base JIRA url")
+	var statePath string
+	var incremental string
+	var auth string
+	var user string
+	var pass string
+	var ckey string
+	var pkey string
+	var tokenCache string
+	var storeKind string
+	var dsn string
+	var backend string
+	var ghOwner string
+	var ghRepo string
+	var glProject string
+	var rps float64
+	var burst int
+	var retries int
+	flag.StringVar(&baseURL, "url", defaultJiraURL,
+		"base JIRA url for -backend=jira; API root for -backend=github|gitlab (defaults to github.com/gitlab.com)")
 	flag.IntVar(&N, "n", 1, "concurrent fetches")
 	flag.StringVar(&outputFile, "output", "apache.json", "output file for database")
 	flag.BoolVar(&debug, "debug", true, "debug output")
+	flag.StringVar(&statePath, "state", "", "path to incremental fetch state file (jira only); with -store=sqlite, state "+
+		"lives in the database instead and only this flag's non-emptiness matters")
+	flag.StringVar(&incremental, "incremental", "created", "watermark field for incremental fetches: created or updated (jira only)")
+	flag.StringVar(&auth, "auth", "", "authentication scheme: basic or oauth (default: anonymous; oauth is jira only)")
+	flag.StringVar(&user, "user", "", "username for -auth=basic")
+	flag.StringVar(&pass, "pass", "", "password or personal access token for -auth=basic")
+	flag.StringVar(&ckey, "ckey", "", "OAuth consumer key for -auth=oauth")
+	flag.StringVar(&pkey, "pkey", "", "path to the OAuth consumer's RSA private key PEM file, for -auth=oauth")
+	flag.StringVar(&tokenCache, "tokencache", "", "path to cache the OAuth access token/secret, for -auth=oauth")
+	flag.StringVar(&storeKind, "store", "json", "storage backend: json, sqlite, or postgres (postgres is not wired up: sqlstore.Open returns an error for it)")
+	flag.StringVar(&dsn, "dsn", "", "data source name for -store=sqlite|postgres (sqlite defaults to -output)")
+	flag.StringVar(&backend, "backend", "jira", "issue tracker backend: jira, github, or gitlab")
+	flag.StringVar(&ghOwner, "owner", "", "GitHub repository owner, for -backend=github")
+	flag.StringVar(&ghRepo, "repo", "", "GitHub repository name, for -backend=github")
+	flag.StringVar(&glProject, "project", "", "GitLab project id or namespace/project path (not URL-encoded), for -backend=gitlab")
+	flag.Float64Var(&rps, "rps", 0, "rate limit requests per second (0 disables rate limiting and retry)")
+	flag.IntVar(&burst, "burst", 1, "rate limiter burst size, for -rps > 0")
+	flag.IntVar(&retries, "retries", jsonutil.DefaultMaxRetries, "max retries on 429/5xx before giving up, for -rps > 0")
 	flag.Parse()
 
+	// -url's default only makes sense for -backend=jira; leave the other
+	// backends' own defaults (github.com/gitlab.com) alone unless the user
+	// actually passed -url.
+	if backend != "jira" && baseURL == defaultJiraURL {
+		baseURL = ""
+	}
+
 	startTime := time.Now()
 
-	// Get the database
-	t := jira.NewTracker(baseURL)
-	t.FetchAll(N)
-	db := t.GetAll()
+	client, err := newClient(auth, user, pass, ckey, pkey, tokenCache, baseURL, rps, burst, retries)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not set up authentication: %v\n", err)
+		os.Exit(1)
+	}
 
-	// Print out some statistics
-	if debug {
-		fmt.Printf("%d issues, %d parent links, %d general links\n",
-			len(db.Issues),
-			len(db.Tree),
-			len(db.Graph))
+	// jsonDB is non-nil only for -store=json, and is what ends up
+	// JSON-encoded to outputFile below; other backends persist as they go.
+	store, jsonDB, err := newStore(storeKind, outputFile, dsn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open store: %v\n", err)
+		os.Exit(1)
 	}
+	defer store.Close()
 
-	// Output database
-	f, err := os.Create(outputFile)
+	t, jiraTracker, err := newTracker(backend, baseURL, client, store, statePath, incremental, ghOwner, ghRepo, glProject)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "could not output json!")
+		fmt.Fprintf(os.Stderr, "could not set up tracker: %v\n", err)
 		os.Exit(1)
 	}
-	enc := json.NewEncoder(f)
-	enc.Encode(db)
-	f.Close()
+
+	fetchErr := t.FetchAll(N)
+
+	// Print out some statistics
+	if debug {
+		issueCount, parentCount, linkCount, err := store.Stats()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not read store stats: %v\n", err)
+		} else {
+			fmt.Printf("%d issues, %d parent links, %d general links\n",
+				issueCount, parentCount, linkCount)
+		}
+	}
+
+	// json is the only backend that needs an explicit output step; SQL
+	// backends have already persisted everything as it was fetched.
+	if jsonDB != nil {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not output json!")
+			os.Exit(1)
+		}
+		enc := json.NewEncoder(f)
+		enc.Encode(jsonDB)
+		f.Close()
+	}
+
+	// Only advance the watermark once the fetch has fully succeeded --
+	// a partial failure must not move the incremental cursor forward, or
+	// the next run would skip over whatever wasn't fetched this time.
+	// Incremental state is jira-specific today, since it's the only
+	// backend with a JQL watermark clause to rewrite.
+	if statePath != "" {
+		if jiraTracker == nil {
+			fmt.Fprintf(os.Stderr, "-state is only supported for -backend=jira; ignoring\n")
+		} else if fetchErr == nil {
+			watermark, err := store.LatestCreated()
+			if incremental == "updated" {
+				watermark, err = store.LatestUpdated()
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not read watermark: %v\n", err)
+			} else {
+				state := &jira.TrackerState{
+					BaseURL:     baseURL,
+					JQL:         jiraTracker.JQL(),
+					Incremental: incremental,
+					LastSuccess: watermark,
+					MaxResults:  jiraTracker.MaxResults(),
+				}
+				if err := saveState(store, statePath, state); err != nil {
+					fmt.Fprintf(os.Stderr, "could not save state: %v\n", err)
+				}
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "fetch failed, not advancing state: %v\n", fetchErr)
+		}
+	}
+
 	fmt.Println("run took ", time.Since(startTime))
 }
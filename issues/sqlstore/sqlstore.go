@@ -0,0 +1,376 @@
+// vim: ts=4:sw=4
+
+// Package sqlstore is a SQL-backed issues.Store. It normalizes the nested
+// issues/comments/links/tree model that issues.Database keeps in memory
+// into flat tables, mirroring devlake's domain model, so SQL-driven
+// analytics (bottleneck reports, cycle-time queries) are possible without
+// first loading and re-parsing a JSON dump.
+package sqlstore
+
+import (
+	"database/sql"
+	"fmt"
+	"issues"
+	"issues/jira"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS issues (
+	id TEXT PRIMARY KEY,
+	name TEXT,
+	title TEXT,
+	body TEXT,
+	created TIMESTAMP,
+	updated TIMESTAMP,
+	resolution_date TIMESTAMP,
+	status TEXT,
+	type TEXT,
+	assignee TEXT,
+	reporter TEXT
+);
+CREATE TABLE IF NOT EXISTS comments (
+	issue_id TEXT,
+	author_name TEXT,
+	author_email TEXT,
+	created TIMESTAMP,
+	body TEXT
+);
+CREATE TABLE IF NOT EXISTS links (
+	from_id TEXT,
+	to_id TEXT,
+	type TEXT,
+	created TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS parents (
+	child_id TEXT PRIMARY KEY,
+	parent_id TEXT
+);
+CREATE TABLE IF NOT EXISTS collector_state (
+	id INTEGER PRIMARY KEY,
+	version INTEGER,
+	base_url TEXT,
+	jql TEXT,
+	incremental TEXT,
+	last_success TIMESTAMP,
+	max_results INTEGER
+);
+`
+
+// Store is a SQL-backed issues.Store, usable anywhere a Tracker expects one.
+type Store struct {
+	db     *sql.DB
+	driver string
+}
+
+// Open opens (creating tables if necessary) a SQL-backed Store. driver is a
+// database/sql driver name; only "sqlite3" is wired up today. dsn is its
+// corresponding data source name (a file path, for sqlite3).
+func Open(driver, dsn string) (*Store, error) {
+	if driver != "sqlite3" {
+		return nil, fmt.Errorf("sqlstore: unsupported driver %q (only sqlite3 is implemented so far)", driver)
+	}
+	// sqlite3 allows only one writer at a time; a Tracker's FetchAll calls
+	// UpsertIssue/SetParent/AddLink from N concurrent workers, so without
+	// a busy timeout a second writer fails immediately with "database is
+	// locked" instead of waiting its turn. Capping the pool to a single
+	// connection serializes those writes through database/sql itself, on
+	// top of the busy timeout, since go-sqlite3 connections don't share a
+	// lock wait queue across separate *sql.DB connections.
+	if !strings.Contains(dsn, "_busy_timeout") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "_busy_timeout=5000"
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		return nil, err
+	}
+	return &Store{db: db, driver: driver}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// nullTime lets a zero time.Time round-trip through database/sql as NULL
+// rather than as the year-1 timestamp time.Time's zero value represents.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func scanTime(nt sql.NullTime) time.Time {
+	if !nt.Valid {
+		return time.Time{}
+	}
+	return nt.Time
+}
+
+func (s *Store) UpsertIssue(iss issues.Issue) error {
+	_, err := s.db.Exec(`
+		INSERT INTO issues (id, name, title, body, created, updated, resolution_date, status, type, assignee, reporter)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name=excluded.name, title=excluded.title, body=excluded.body,
+			created=excluded.created, updated=excluded.updated,
+			resolution_date=excluded.resolution_date, status=excluded.status,
+			type=excluded.type, assignee=excluded.assignee, reporter=excluded.reporter
+	`, string(iss.Id), iss.Name, iss.Title, iss.Body,
+		nullTime(iss.Created), nullTime(iss.Updated), nullTime(iss.ResolutionDate),
+		iss.Status, iss.Type, iss.Assignee, iss.Reporter)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`DELETE FROM comments WHERE issue_id = ?`, string(iss.Id)); err != nil {
+		return err
+	}
+	for _, c := range iss.Comments {
+		if _, err := s.db.Exec(`
+			INSERT INTO comments (issue_id, author_name, author_email, created, body)
+			VALUES (?, ?, ?, ?, ?)
+		`, string(iss.Id), c.AuthorName, c.AuthorEmail, nullTime(c.Created), c.Body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) SetParent(child, parent issues.Id) error {
+	_, err := s.db.Exec(`
+		INSERT INTO parents (child_id, parent_id) VALUES (?, ?)
+		ON CONFLICT (child_id) DO UPDATE SET parent_id=excluded.parent_id
+	`, string(child), string(parent))
+	return err
+}
+
+// AddLink is a no-op if an identical From/To/Type link is already recorded --
+// otherwise a link already known from a previous incremental run would grow
+// the links table unboundedly every time the issue it's attached to is
+// re-fetched.
+func (s *Store) AddLink(l issues.Link) error {
+	var exists int
+	err := s.db.QueryRow(`
+		SELECT 1 FROM links WHERE from_id = ? AND to_id = ? AND type = ? LIMIT 1
+	`, string(l.From), string(l.To), l.Type).Scan(&exists)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO links (from_id, to_id, type, created) VALUES (?, ?, ?, ?)
+	`, string(l.From), string(l.To), l.Type, nullTime(l.Created))
+	return err
+}
+
+func (s *Store) SetLinkCreated(from, to issues.Id, created time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE links SET created = ? WHERE from_id = ? AND to_id = ?
+	`, created, string(from), string(to))
+	return err
+}
+
+func (s *Store) commentsFor(issueID string) ([]issues.Comment, error) {
+	rows, err := s.db.Query(`
+		SELECT author_name, author_email, created, body FROM comments WHERE issue_id = ?
+	`, issueID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var comments []issues.Comment
+	for rows.Next() {
+		var c issues.Comment
+		var created sql.NullTime
+		if err := rows.Scan(&c.AuthorName, &c.AuthorEmail, &created, &c.Body); err != nil {
+			return nil, err
+		}
+		c.Created = scanTime(created)
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func (s *Store) IterIssues(fn func(issues.Issue) error) error {
+	rows, err := s.db.Query(`
+		SELECT id, name, title, body, created, updated, resolution_date, status, type, assignee, reporter FROM issues
+	`)
+	if err != nil {
+		return err
+	}
+	var snapshot []issues.Issue
+	for rows.Next() {
+		var id, name, title, body, status, typ, assignee, reporter string
+		var created, updated, resolutionDate sql.NullTime
+		if err := rows.Scan(&id, &name, &title, &body, &created, &updated, &resolutionDate,
+			&status, &typ, &assignee, &reporter); err != nil {
+			rows.Close()
+			return err
+		}
+		snapshot = append(snapshot, issues.Issue{
+			Id: issues.Id(id), Name: name, Title: title, Body: body,
+			Created: scanTime(created), Updated: scanTime(updated), ResolutionDate: scanTime(resolutionDate),
+			Status: status, Type: typ, Assignee: assignee, Reporter: reporter,
+		})
+	}
+	closeErr := rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	for _, iss := range snapshot {
+		comments, err := s.commentsFor(string(iss.Id))
+		if err != nil {
+			return err
+		}
+		iss.Comments = comments
+		if err := fn(iss); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) IterParents(fn func(child, parent issues.Id) error) error {
+	rows, err := s.db.Query(`SELECT child_id, parent_id FROM parents`)
+	if err != nil {
+		return err
+	}
+	type pair struct{ child, parent string }
+	var snapshot []pair
+	for rows.Next() {
+		var p pair
+		if err := rows.Scan(&p.child, &p.parent); err != nil {
+			rows.Close()
+			return err
+		}
+		snapshot = append(snapshot, p)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, p := range snapshot {
+		if err := fn(issues.Id(p.child), issues.Id(p.parent)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) IterLinks(fn func(issues.Link) error) error {
+	rows, err := s.db.Query(`SELECT from_id, to_id, type, created FROM links`)
+	if err != nil {
+		return err
+	}
+	var snapshot []issues.Link
+	for rows.Next() {
+		var from, to string
+		var l issues.Link
+		var created sql.NullTime
+		if err := rows.Scan(&from, &to, &l.Type, &created); err != nil {
+			rows.Close()
+			return err
+		}
+		l.From, l.To = issues.Id(from), issues.Id(to)
+		l.Created = scanTime(created)
+		snapshot = append(snapshot, l)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, l := range snapshot {
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) LatestCreated() (time.Time, error) {
+	return s.latest("created")
+}
+
+func (s *Store) LatestUpdated() (time.Time, error) {
+	return s.latest("updated")
+}
+
+func (s *Store) latest(column string) (time.Time, error) {
+	if strings.ContainsAny(column, " ;") {
+		return time.Time{}, fmt.Errorf("sqlstore: invalid column %q", column)
+	}
+	var t sql.NullTime
+	err := s.db.QueryRow(fmt.Sprintf(`SELECT MAX(%s) FROM issues`, column)).Scan(&t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return scanTime(t), nil
+}
+
+func (s *Store) Stats() (issueCount, parentCount, linkCount int, err error) {
+	if err = s.db.QueryRow(`SELECT COUNT(*) FROM issues`).Scan(&issueCount); err != nil {
+		return
+	}
+	if err = s.db.QueryRow(`SELECT COUNT(*) FROM parents`).Scan(&parentCount); err != nil {
+		return
+	}
+	err = s.db.QueryRow(`SELECT COUNT(*) FROM links`).Scan(&linkCount)
+	return
+}
+
+// LoadState and SaveState implement jira.StateStore, persisting a
+// jira.TrackerState in the collector_state table (a single row, id=1)
+// instead of a side JSON file -- so -store=sqlite doesn't need a separate
+// -state path alongside the database.
+func (s *Store) LoadState() (jira.TrackerState, error) {
+	var st jira.TrackerState
+	var lastSuccess sql.NullTime
+	row := s.db.QueryRow(`
+		SELECT version, base_url, jql, incremental, last_success, max_results
+		FROM collector_state WHERE id = 1
+	`)
+	err := row.Scan(&st.Version, &st.BaseURL, &st.JQL, &st.Incremental, &lastSuccess, &st.MaxResults)
+	if err == sql.ErrNoRows {
+		return jira.TrackerState{}, nil
+	}
+	if err != nil {
+		return jira.TrackerState{}, err
+	}
+	st.LastSuccess = scanTime(lastSuccess)
+	return st, nil
+}
+
+func (s *Store) SaveState(st jira.TrackerState) error {
+	_, err := s.db.Exec(`
+		INSERT INTO collector_state (id, version, base_url, jql, incremental, last_success, max_results)
+		VALUES (1, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			version=excluded.version, base_url=excluded.base_url, jql=excluded.jql,
+			incremental=excluded.incremental, last_success=excluded.last_success,
+			max_results=excluded.max_results
+	`, st.Version, st.BaseURL, st.JQL, st.Incremental, nullTime(st.LastSuccess), st.MaxResults)
+	return err
+}
@@ -0,0 +1,169 @@
+// vim: ts=4:sw=4
+package sqlstore
+
+import (
+	"issues"
+	"issues/jira"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	s, err := Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestUpsertIssueRoundTrip(t *testing.T) {
+	s := openTestStore(t)
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	iss := issues.Issue{
+		Id:      "PROJ-1",
+		Title:   "first title",
+		Created: created,
+		Comments: []issues.Comment{
+			{AuthorName: "alice", Body: "first comment"},
+		},
+	}
+	if err := s.UpsertIssue(iss); err != nil {
+		t.Fatalf("UpsertIssue: %v", err)
+	}
+
+	// Re-upserting with a different title and comment set should replace,
+	// not duplicate, both the issue row and its comments.
+	iss.Title = "updated title"
+	iss.Comments = []issues.Comment{
+		{AuthorName: "bob", Body: "second comment"},
+	}
+	if err := s.UpsertIssue(iss); err != nil {
+		t.Fatalf("UpsertIssue (update): %v", err)
+	}
+
+	var got []issues.Issue
+	if err := s.IterIssues(func(iss issues.Issue) error {
+		got = append(got, iss)
+		return nil
+	}); err != nil {
+		t.Fatalf("IterIssues: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("len(got) = %d, want 1 (upsert of the same Id should not duplicate)", len(got))
+	}
+	if got[0].Title != "updated title" {
+		t.Errorf("got title %q, want %q", got[0].Title, "updated title")
+	}
+	if !got[0].Created.Equal(created) {
+		t.Errorf("got Created %v, want %v (non-zero time should round-trip)", got[0].Created, created)
+	}
+	if len(got[0].Comments) != 1 || got[0].Comments[0].AuthorName != "bob" {
+		t.Errorf("got comments %v, want exactly bob's comment (stale comments should be replaced)", got[0].Comments)
+	}
+}
+
+func TestSetParent(t *testing.T) {
+	s := openTestStore(t)
+
+	if err := s.SetParent("PROJ-2", "PROJ-1"); err != nil {
+		t.Fatalf("SetParent: %v", err)
+	}
+	// Re-parenting an existing child should update, not add a second row.
+	if err := s.SetParent("PROJ-2", "PROJ-3"); err != nil {
+		t.Fatalf("SetParent (reparent): %v", err)
+	}
+
+	var pairs [][2]issues.Id
+	if err := s.IterParents(func(child, parent issues.Id) error {
+		pairs = append(pairs, [2]issues.Id{child, parent})
+		return nil
+	}); err != nil {
+		t.Fatalf("IterParents: %v", err)
+	}
+	if len(pairs) != 1 {
+		t.Fatalf("len(pairs) = %d, want 1", len(pairs))
+	}
+	if pairs[0][1] != "PROJ-3" {
+		t.Errorf("got parent %q, want %q", pairs[0][1], "PROJ-3")
+	}
+}
+
+func TestAddLinkDedup(t *testing.T) {
+	s := openTestStore(t)
+
+	l := issues.Link{From: "PROJ-1", To: "PROJ-2", Type: "relates"}
+	if err := s.AddLink(l); err != nil {
+		t.Fatalf("AddLink: %v", err)
+	}
+	if err := s.AddLink(l); err != nil {
+		t.Fatalf("AddLink (repeat): %v", err)
+	}
+	if err := s.AddLink(issues.Link{From: "PROJ-1", To: "PROJ-2", Type: "blocks"}); err != nil {
+		t.Fatalf("AddLink (different type): %v", err)
+	}
+
+	var links []issues.Link
+	if err := s.IterLinks(func(l issues.Link) error {
+		links = append(links, l)
+		return nil
+	}); err != nil {
+		t.Fatalf("IterLinks: %v", err)
+	}
+	if len(links) != 2 {
+		t.Fatalf("len(links) = %d, want 2 (re-adding an identical link should be a no-op, but a different type is not a duplicate)", len(links))
+	}
+}
+
+func TestLoadSaveState(t *testing.T) {
+	s := openTestStore(t)
+
+	got, err := s.LoadState()
+	if err != nil {
+		t.Fatalf("LoadState (empty): %v", err)
+	}
+	if got != (jira.TrackerState{}) {
+		t.Errorf("LoadState (empty) = %+v, want zero value", got)
+	}
+
+	want := jira.TrackerState{
+		Version:     jira.StateSchemaVersion,
+		BaseURL:     "https://issues.apache.org/jira",
+		JQL:         "project = PROJ",
+		Incremental: "updated",
+		LastSuccess: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		MaxResults:  50,
+	}
+	if err := s.SaveState(want); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+	got, err = s.LoadState()
+	if err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	if !got.LastSuccess.Equal(want.LastSuccess) {
+		t.Errorf("got LastSuccess %v, want %v", got.LastSuccess, want.LastSuccess)
+	}
+	got.LastSuccess = want.LastSuccess
+	if got != want {
+		t.Errorf("LoadState round-trip = %+v, want %+v", got, want)
+	}
+
+	// SaveState again should update the single row (id=1), not insert a
+	// second one.
+	want.JQL = "project = OTHER"
+	if err := s.SaveState(want); err != nil {
+		t.Fatalf("SaveState (update): %v", err)
+	}
+	got, err = s.LoadState()
+	if err != nil {
+		t.Fatalf("LoadState (after update): %v", err)
+	}
+	if got.JQL != "project = OTHER" {
+		t.Errorf("got JQL %q, want %q", got.JQL, "project = OTHER")
+	}
+}
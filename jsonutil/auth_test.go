@@ -0,0 +1,29 @@
+// vim: ts=4:sw=4
+package jsonutil
+
+import "testing"
+
+func TestPercentEncode(t *testing.T) {
+	cases := map[string]string{
+		"abc123-._~":  "abc123-._~",
+		"hello world": "hello%20world",
+		"a=b&c":       "a%3Db%26c",
+	}
+	for in, want := range cases {
+		if got := percentEncode(in); got != want {
+			t.Errorf("percentEncode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSignatureBaseString(t *testing.T) {
+	params := map[string]string{
+		"oauth_nonce":     "abc",
+		"oauth_timestamp": "123",
+	}
+	got := signatureBaseString("get", "https://example.com/search", params)
+	want := "GET&https%3A%2F%2Fexample.com%2Fsearch&oauth_nonce%3Dabc%26oauth_timestamp%3D123"
+	if got != want {
+		t.Errorf("signatureBaseString = %q, want %q", got, want)
+	}
+}
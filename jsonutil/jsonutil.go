@@ -1,35 +1,104 @@
 // vim: ts=4:sw=4
 package jsonutil
 
-// Package to make working with decoding arbitrary JSON objects easier. Makes
-// type assertions simpler and safer.
+// Package to make working with JSON APIs easier: issuing a request and
+// decoding its response into a typed value, plus a handful of map/slice
+// helpers for the genuinely dynamic fields a typed struct can't cover.
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/url"
 )
 
-// Fetch a JSON resource with an interface tuned for REST applications: the
-// params are URL-encoded to be added to the baseURL and a decoded JSON value
-// is returned.
-func Get(baseURL string,
-	params map[string]string) (v map[string]interface{}, err error) {
+// Decode decodes a single JSON value from r into v. It uses json.Decoder
+// with UseNumber so large integers (e.g. JIRA ids) survive round-tripping
+// through an interface{} field without silently losing precision to
+// float64, and so a caller that does need a raw number back can recover it
+// exactly via GetInt.
+func Decode(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// GetResponse issues a GET request with an interface tuned for REST
+// applications: the params are URL-encoded to be added to baseURL. The full
+// *http.Response is returned (rather than just its decoded body) so a
+// caller that needs response headers -- e.g. GitHub's Link: or GitLab's
+// X-Total-Pages pagination headers -- can read them alongside the body.
+// client is used to issue the request, so callers needing authentication
+// can pass one built by NewBasicAuthClient/NewOAuth1Client; a nil client
+// falls back to http.DefaultClient. The caller must close resp.Body.
+func GetResponse(client *http.Client, baseURL string, params map[string]string) (resp *http.Response, err error) {
 	p := url.Values{}
 	for key, val := range params {
 		p.Add(key, val)
 	}
-	resp, err := http.Get(baseURL + "?" + p.Encode())
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest("GET", baseURL+"?"+p.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err = client.Do(req)
 	if err != nil {
-		return
+		return nil, err
 	}
-	dec := json.NewDecoder(resp.Body)
-	err = dec.Decode(&v)
-	return
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+	}
+	return resp, nil
+}
+
+// StatusError reports an HTTP response with status 400 or above, the way RateLimitError and
+// ServerError report non-2xx statuses that RateLimitedTransport decided not
+// to retry. Callers that want to handle a particular status specially (e.g.
+// treating 404 from an optional endpoint as "nothing there" rather than a
+// fatal error) can type-assert for it.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return e.Status + ": " + e.Body
 }
 
-// Safely convert an interface to a JSON object map.  If provided interface is
-// nil, returns a new map (which can be safely indexed).
+// GetReader is GetResponse for callers that only need the body -- either to
+// Decode wholesale, or, as jira.GetFrom does, to stream-decode
+// token-by-token to avoid materializing a large response all at once. The
+// caller must close the returned body.
+func GetReader(client *http.Client, baseURL string, params map[string]string) (io.ReadCloser, error) {
+	resp, err := GetResponse(client, baseURL, params)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Get issues a GET request via GetReader and Decodes the whole response
+// into v. Suitable whenever the response is small enough to materialize in
+// full; larger, array-shaped responses should use GetReader directly and
+// stream-decode instead (see jira.GetFrom).
+func Get(client *http.Client, baseURL string, params map[string]string, v interface{}) error {
+	body, err := GetReader(client, baseURL, params)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return Decode(body, v)
+}
+
+// GetMap safely converts a decoded interface{} to a JSON object map, for
+// fields too dynamic to give a struct tag (e.g. a field keyed by an
+// unpredictable name). If v is nil, returns a new map (which can be safely
+// indexed).
 func GetMap(v interface{}) map[string]interface{} {
 	if v == nil {
 		return make(map[string]interface{})
@@ -37,11 +106,23 @@ func GetMap(v interface{}) map[string]interface{} {
 	return v.(map[string]interface{})
 }
 
+// GetInt safely converts a decoded interface{} holding a JSON number to an
+// int. Decode uses UseNumber, so v is normally a json.Number, but a plain
+// float64 (e.g. from an ordinary json.Unmarshal elsewhere) is also accepted.
 func GetInt(v interface{}) int {
-	return int(v.(int64))
+	switch n := v.(type) {
+	case json.Number:
+		i, _ := n.Int64()
+		return int(i)
+	case float64:
+		return int(n)
+	default:
+		return 0
+	}
 }
 
-// Safely get a string value from a map
+// GetString safely gets a string value from a map, for fields too dynamic
+// to give a struct tag.
 func GetString(m map[string]interface{}, key string) string {
 	if v, ok := m[key]; ok && v != nil {
 		return v.(string)
@@ -0,0 +1,143 @@
+// vim: ts=4:sw=4
+package jsonutil
+
+// A RoundTripper that throttles and retries requests, for trackers (like
+// jira.Tracker.FetchAll) that fire many requests concurrently and would
+// otherwise trip a server's rate limiter and have the failed batch just
+// get fmt.Println'ed away.
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// DefaultMaxRetries is how many times RateLimitedTransport retries a
+// request that comes back 429 or 5xx before giving up.
+const DefaultMaxRetries = 5
+
+const baseBackoff = 500 * time.Millisecond
+const maxBackoff = 30 * time.Second
+
+// NewLimiter builds a rate.Limiter allowing rps requests per second, with
+// bursts up to burst.
+func NewLimiter(rps float64, burst int) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(rps), burst)
+}
+
+// RateLimitedTransport wraps a base client's transport with request-rate
+// limiting and bounded retry with exponential backoff on 429/5xx responses.
+type RateLimitedTransport struct {
+	Client     *http.Client
+	Limiter    *rate.Limiter // nil disables rate limiting
+	MaxRetries int
+}
+
+// NewRateLimitedClient returns an *http.Client that rate-limits and retries
+// every request through client (nil defaults to http.DefaultClient; to
+// layer with authentication, pass the *http.Client NewBasicAuthClient or
+// NewOAuth1Client already returned, so every retry is still signed). A nil
+// limiter disables rate limiting; only the retry behavior applies.
+func NewRateLimitedClient(client *http.Client, limiter *rate.Limiter, maxRetries int) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := *client
+	c.Transport = &RateLimitedTransport{Client: client, Limiter: limiter, MaxRetries: maxRetries}
+	return &c
+}
+
+func (rt *RateLimitedTransport) transport() http.RoundTripper {
+	if rt.Client.Transport != nil {
+		return rt.Client.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (rt *RateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := rt.transport()
+	for attempt := 0; ; attempt++ {
+		if rt.Limiter != nil {
+			if err := rt.Limiter.Wait(req.Context()); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return resp, nil
+		}
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+		resp.Body.Close()
+		if attempt >= rt.MaxRetries {
+			if resp.StatusCode == http.StatusTooManyRequests {
+				return nil, &RateLimitError{Attempts: attempt + 1, RetryAfter: retryAfter}
+			}
+			return nil, &ServerError{Attempts: attempt + 1, StatusCode: resp.StatusCode}
+		}
+		time.Sleep(backoff(attempt, retryAfter))
+	}
+}
+
+// RateLimitError reports that a request was still being rate-limited (HTTP
+// 429) after exhausting RateLimitedTransport's retry budget.
+type RateLimitError struct {
+	Attempts   int
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("jsonutil: still rate limited after %d attempts (server asked to wait %s)",
+		e.Attempts, e.RetryAfter)
+}
+
+// ServerError reports that a request kept failing with a 5xx status after
+// exhausting RateLimitedTransport's retry budget.
+type ServerError struct {
+	Attempts   int
+	StatusCode int
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("jsonutil: server error %d after %d attempts", e.StatusCode, e.Attempts)
+}
+
+// backoff computes how long to sleep before retry number attempt+1: an
+// exponential backoff starting at baseBackoff and doubling each attempt,
+// capped at maxBackoff, with up to 20% jitter to keep concurrent retries
+// from synchronizing -- or retryAfter, if the server asked for longer.
+func backoff(attempt int, retryAfter time.Duration) time.Duration {
+	d := baseBackoff * time.Duration(1<<uint(attempt))
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	d += time.Duration(rand.Int63n(int64(d)/5 + 1))
+	if retryAfter > d {
+		return retryAfter
+	}
+	return d
+}
+
+// parseRetryAfter parses a Retry-After header value, which per RFC 9110 is
+// either a number of seconds or an HTTP-date. An empty or unparseable value
+// returns 0.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
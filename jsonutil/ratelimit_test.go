@@ -0,0 +1,41 @@
+// vim: ts=4:sw=4
+package jsonutil
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	if got, want := parseRetryAfter(""), time.Duration(0); got != want {
+		t.Errorf("parseRetryAfter(\"\") = %v, want %v", got, want)
+	}
+	if got, want := parseRetryAfter("not a number or date"), time.Duration(0); got != want {
+		t.Errorf("parseRetryAfter(garbage) = %v, want %v", got, want)
+	}
+	if got, want := parseRetryAfter("30"), 30*time.Second; got != want {
+		t.Errorf("parseRetryAfter(\"30\") = %v, want %v", got, want)
+	}
+
+	future := time.Now().Add(2 * time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(future); got <= 0 || got > 2*time.Minute {
+		t.Errorf("parseRetryAfter(HTTP-date) = %v, want roughly 2m", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	// with no Retry-After hint, backoff should grow with the attempt
+	// number and never exceed maxBackoff (plus its jitter allowance)
+	if d := backoff(0, 0); d < baseBackoff {
+		t.Errorf("backoff(0, 0) = %v, want >= baseBackoff (%v)", d, baseBackoff)
+	}
+	if d := backoff(20, 0); d < maxBackoff || d > maxBackoff+maxBackoff/5 {
+		t.Errorf("backoff(20, 0) = %v, want within jitter of maxBackoff (%v)", d, maxBackoff)
+	}
+
+	// a Retry-After longer than the computed backoff wins
+	if d := backoff(0, time.Minute); d != time.Minute {
+		t.Errorf("backoff(0, 1m) = %v, want 1m", d)
+	}
+}